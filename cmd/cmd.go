@@ -1,9 +1,9 @@
 package main
 
 import (
-	"context"
 	"os"
 	"os/signal"
+	"runtime"
 
 	"github.com/rosedblabs/rosedb/v2"
 	"github.com/urfave/cli/v2"
@@ -12,33 +12,44 @@ import (
 )
 
 func runCmd(cCtx *cli.Context) error {
-	ctx, err := initArgs(cCtx)
+	cfg, err := initArgs(cCtx)
 	if err != nil {
 		return err
 	}
 
 	options := rosedb.DefaultOptions
-	options.DirPath = ctx.Value("dbfile").(string)
+	options.DirPath = cfg.DBFile
 	db, err := rosedb.Open(options)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	ctx = context.WithValue(ctx, "database", db)
-
-	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, stop := signal.NotifyContext(cCtx.Context, os.Interrupt)
 	defer stop()
 
-	counter := int64(0)
-
-	ctx = context.WithValue(ctx, "counter", &counter)
+	scanner, err := files.NewScanner(cfg.Path, cfg.Transcoder, cfg.Probe, db)
+	if err != nil {
+		return err
+	}
+	scanCfg := files.ScanConfig{
+		Path:    ".",
+		Args:    cfg.Args,
+		Encoder: cfg.Encoder,
+		Workers: cfg.Workers,
+		Prune:   cfg.Prune,
+		DryRun:  cfg.DryRun,
+	}
 
-	if err = files.IndexFlacs(ctx); err != nil {
+	if _, err := scanner.Index(ctx, scanCfg); err != nil {
 		return err
 	}
 
-	if err = files.ReencodeFlacs(ctx); err != nil {
+	if cfg.DryRun {
+		return nil
+	}
+
+	if err := scanner.Reencode(ctx, scanCfg); err != nil {
 		return err
 	}
 
@@ -68,11 +79,31 @@ func Start() {
 				Usage:   "Path to database",
 				Aliases: []string{"d"},
 			},
+			&cli.StringFlag{
+				Name:    "codec",
+				Usage:   "Codec to reencode to: flac, opus, mp3, vorbis, alac or aac",
+				Value:   "flac",
+				Aliases: []string{"c"},
+			},
 			&cli.StringSliceFlag{
-				Name:    "flac",
-				Usage:   "Flac arguments to use when reencoding, can be used multiple times",
+				Name:    "args",
+				Usage:   "Encoder arguments to use when reencoding, can be used multiple times",
 				Aliases: []string{"a"},
 			},
+			&cli.IntFlag{
+				Name:    "workers",
+				Usage:   "Number of parallel workers used while indexing",
+				Value:   runtime.NumCPU(),
+				Aliases: []string{"w"},
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete database entries for files no longer found under path",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Report what indexing would do without writing to the database or reencoding",
+			},
 		},
 		Action: runCmd,
 	}
@@ -1,17 +1,32 @@
 package main
 
 import (
-	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strings"
 
 	"github.com/urfave/cli/v2"
+
+	"github.com/justjakka/reencoder/files"
 )
 
+// runConfig carries everything runCmd needs out of the CLI flags, replacing
+// the context.Value("path"|"encoder"|...) pattern this package used to rely on.
+type runConfig struct {
+	DBFile     string
+	Path       string
+	Args       []string
+	Transcoder files.Transcoder
+	Probe      files.MetadataProbe
+	Encoder    files.EncoderInfo
+	Workers    int
+	Prune      bool
+	DryRun     bool
+}
+
 func getLocalStorage() string {
 	switch runtime.GOOS {
 	case "windows":
@@ -27,33 +42,55 @@ func getLocalStorage() string {
 	}
 }
 
-func getDb(cCtx *cli.Context) (context.Context, error) {
+func getDb(cCtx *cli.Context) (string, error) {
 	if cCtx.Path("dbfile") == "" {
 		localFolder := getLocalStorage()
 		if localFolder == "" {
-			return context.WithValue(cCtx.Context, "dbfile", ""), errors.New("failed to locate application data folder")
+			return "", errors.New("failed to locate application data folder")
 		}
 
-		return context.WithValue(cCtx.Context, "dbfile", filepath.Join(localFolder, "reencoder")), nil
+		return filepath.Join(localFolder, "reencoder"), nil
 	}
 	if _, err := os.Stat(cCtx.Path("dbfile")); err != nil {
-		return context.WithValue(cCtx.Context, "dbfile", ""), err
+		return "", err
 	}
-	return context.WithValue(cCtx.Context, "dbfile", cCtx.Path("dbfile")), nil
+	return cCtx.Path("dbfile"), nil
 }
 
-func checkTools() error {
-	if _, err := exec.LookPath("flac"); err != nil {
-		return errors.New("missing flac executable")
+func checkTools(codec string) error {
+	if codec == "flac" {
+		if _, err := exec.LookPath("flac"); err != nil {
+			return errors.New("missing flac executable")
+		}
+		if _, err := exec.LookPath("metaflac"); err != nil {
+			return errors.New("missing metaflac executable")
+		}
+		return nil
 	}
-	if _, err := exec.LookPath("metaflac"); err != nil {
-		return errors.New("missing metaflac executable")
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return errors.New("missing ffmpeg executable")
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return errors.New("missing ffprobe executable")
 	}
 	return nil
 }
 
-func initArgs(cCtx *cli.Context) (context.Context, error) {
-	if err := checkTools(); err != nil {
+func initArgs(cCtx *cli.Context) (*runConfig, error) {
+	codec := cCtx.String("codec")
+
+	transcoder, err := files.NewTranscoder(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	probe, ok := transcoder.(files.MetadataProbe)
+	if !ok {
+		return nil, fmt.Errorf("transcoder %q cannot probe file metadata", codec)
+	}
+
+	if err := checkTools(codec); err != nil {
 		return nil, err
 	}
 
@@ -61,24 +98,36 @@ func initArgs(cCtx *cli.Context) (context.Context, error) {
 		return nil, err
 	}
 
-	ctx, err := getDb(cCtx)
+	dbfile, err := getDb(cCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx = context.WithValue(ctx, "path", cCtx.Path("path"))
-
-	encoder, err := exec.Command("flac", "-v").Output()
+	version, err := transcoder.Version()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx = context.WithValue(ctx, "encoder", strings.ReplaceAll(strings.Split(string(encoder), " ")[1], "\n", ""))
+	workers := cCtx.Int("workers")
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
 
-	defargs := []string{"-8f", "-j4"}
+	cfg := &runConfig{
+		DBFile:     dbfile,
+		Path:       cCtx.Path("path"),
+		Transcoder: transcoder,
+		Probe:      probe,
+		Encoder:    files.EncoderInfo{Codec: codec, Version: version},
+		Workers:    workers,
+		Prune:      cCtx.Bool("prune"),
+		DryRun:     cCtx.Bool("dry-run"),
+	}
 
-	if cCtx.Value("flac") == nil {
-		return context.WithValue(ctx, "flac", defargs), nil
+	if cCtx.Value("args") == nil || len(cCtx.StringSlice("args")) == 0 {
+		cfg.Args = files.DefaultArgs(codec)
+	} else {
+		cfg.Args = cCtx.StringSlice("args")
 	}
-	return context.WithValue(ctx, "flac", cCtx.StringSlice("flac")), nil
+	return cfg, nil
 }
@@ -0,0 +1,63 @@
+// Package mockfs builds synthetic audio-file trees for testing files.Scanner
+// without touching the real filesystem or shelling out to flac/ffmpeg.
+package mockfs
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+)
+
+// FileSpec describes one synthetic file in the tree.
+type FileSpec struct {
+	Path    string
+	Content string
+	Encoder string
+}
+
+// New builds an fs.FS containing one entry per spec.
+func New(specs ...FileSpec) fstest.MapFS {
+	fsys := make(fstest.MapFS, len(specs))
+	for _, spec := range specs {
+		content := spec.Content
+		if content == "" {
+			content = spec.Path
+		}
+		fsys[spec.Path] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return fsys
+}
+
+// Transcoder is a fake files.Transcoder/files.MetadataProbe pair driven by a
+// per-path vendor tag table, recording every path it's asked to Encode. When
+// FS is set, Encode simulates an in-place codec change the way
+// FFmpegTranscoder does against real ffmpeg: it renames the backing
+// fstest.MapFS entry to carry Extension and reports the new path back.
+type Transcoder struct {
+	Codec     string
+	Extension string
+	Vers      string
+	Vendor    map[string]string
+	FS        fstest.MapFS
+	Encoded   []string
+}
+
+func (t *Transcoder) Name() string { return t.Codec }
+
+func (t *Transcoder) Ext() string { return t.Extension }
+
+func (t *Transcoder) Version() (string, error) { return t.Vers, nil }
+
+func (t *Transcoder) Probe(path string) (string, error) { return t.Vendor[path], nil }
+
+func (t *Transcoder) Encode(ctx context.Context, src string, args []string) (string, error) {
+	t.Encoded = append(t.Encoded, src)
+
+	dst := strings.TrimSuffix(src, filepath.Ext(src)) + t.Extension
+	if t.FS != nil && dst != src {
+		t.FS[dst] = t.FS[src]
+		delete(t.FS, src)
+	}
+	return dst, nil
+}
@@ -0,0 +1,411 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/rosedblabs/rosedb/v2"
+	progressbar "github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// ScanConfig carries the per-run settings a Scanner needs, in place of the
+// context.Value("path"|"encoder"|...) lookups the package used to do.
+type ScanConfig struct {
+	// Path is the root to walk, relative to the Scanner's FS.
+	Path string
+	// Args are the transcoder arguments to use when reencoding.
+	Args []string
+	// Encoder identifies the codec/encoder pair files are expected to carry
+	// once reencoded.
+	Encoder EncoderInfo
+	// Workers is how many goroutines hash and probe files concurrently
+	// while indexing. Defaults to runtime.NumCPU() when <= 0.
+	Workers int
+	// Prune deletes database entries whose file no longer exists under
+	// Path. Without it, orphans are only counted in ReconcileStats.
+	Prune bool
+	// DryRun reports what Index would do without writing anything back to
+	// the database, so the Deleted count can be previewed before a --prune
+	// run actually removes anything. Pruned stays 0 in a dry run, even with
+	// Prune set, since nothing is deleted.
+	DryRun bool
+}
+
+// ReconcileStats summarizes how Index's scan compared against what was
+// already in the database.
+type ReconcileStats struct {
+	New       int64
+	Moved     int64
+	Unchanged int64
+	ToProcess int64
+	Deleted   int64
+	Pruned    int64
+}
+
+// indexed is what a worker hands back to the goroutine collecting scan
+// results.
+type indexed struct {
+	info    *FileInfo
+	hashsum []byte
+	err     error
+}
+
+// Scanner indexes and reencodes a library of audio files. Its FS is an
+// fs.FS so the whole state machine can be driven against a synthetic tree
+// (see files/internal/mockfs) instead of the real filesystem.
+type Scanner struct {
+	FS         fs.FS
+	Root       string
+	Transcoder Transcoder
+	Probe      MetadataProbe
+	DB         *rosedb.DB
+}
+
+// NewScanner builds a Scanner rooted at a real directory on disk. root is
+// normalized to an absolute path so FileInfo.AbsPath is stable regardless of
+// how --path was spelled on a given invocation: a relative root would make
+// reconcile's filepath.Rel(s.Root, stored.AbsPath) error whenever a prior
+// run had been invoked with a different (e.g. absolute) root, silently
+// dropping that entry instead of reconciling it.
+func NewScanner(root string, transcoder Transcoder, probe MetadataProbe, db *rosedb.DB) (*Scanner, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scanner{
+		FS:         os.DirFS(root),
+		Root:       root,
+		Transcoder: transcoder,
+		Probe:      probe,
+		DB:         db,
+	}, nil
+}
+
+func (s *Scanner) getInfoFromFile(path string) (*FileInfo, error) {
+	var filedata FileInfo
+
+	filedata.AbsPath = filepath.Join(s.Root, path)
+
+	version, err := s.Probe.Probe(filedata.AbsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	filedata.Encoder = EncoderInfo{Codec: s.Transcoder.Name(), Version: version}
+
+	return &filedata, nil
+}
+
+// collectHashes walks cfg.Path and hashes+probes every file with a
+// recognized audio extension (see isAudioFile), fanning the work out across cfg.Workers
+// goroutines. It returns every file found, keyed by its content hash, so
+// reconcile can tell a rename (same hash, new path) apart from a genuinely
+// new or deleted file.
+func (s *Scanner) collectHashes(ctx context.Context, cfg ScanConfig, spin *spinner.Spinner) (map[string]*FileInfo, error) {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	paths := make(chan string)
+	results := make(chan indexed)
+
+	var walkErr error
+	go func() {
+		defer close(paths)
+		walkErr = fs.WalkDir(s.FS, cfg.Path, func(path string, entry fs.DirEntry, err error) error {
+			select {
+			case <-ctx.Done():
+				return fs.SkipAll
+			default:
+			}
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !isAudioFile(path) {
+				return nil
+			}
+			select {
+			case paths <- path:
+			case <-ctx.Done():
+				return fs.SkipAll
+			}
+			return nil
+		})
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				data, err := s.getInfoFromFile(path)
+				if err != nil {
+					results <- indexed{err: err}
+					continue
+				}
+
+				hashsum, err := getSha256(s.FS, path)
+				results <- indexed{info: data, hashsum: hashsum, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	seen := make(map[string]*FileInfo)
+	var counter atomic.Int64
+
+	var resultErr error
+	for res := range results {
+		if res.err != nil {
+			if resultErr == nil {
+				resultErr = res.err
+			}
+			continue
+		}
+
+		seen[string(res.hashsum)] = res.info
+		counter.Add(1)
+		spin.Suffix = fmt.Sprintf(" Scanning...\t %v", counter.Load())
+	}
+
+	if resultErr == nil {
+		resultErr = walkErr
+	}
+
+	return seen, resultErr
+}
+
+// reconcile resolves every file collectHashes found against whatever is
+// already stored in the database. A hash present in both is unchanged,
+// moved (same hash, new path) or flagged for reencoding; a hash left in the
+// database but absent from seen is an orphan, deleted only when cfg.Prune
+// is set; anything left over in seen once the database has been walked is
+// a brand new file.
+func (s *Scanner) reconcile(ctx context.Context, cfg ScanConfig, seen map[string]*FileInfo) (ReconcileStats, error) {
+	var stats ReconcileStats
+
+	batch := s.DB.NewBatch(rosedb.DefaultBatchOptions)
+
+	iterOpts := rosedb.DefaultIteratorOptions
+	iterOpts.ContinueOnError = true
+	iter := s.DB.NewIterator(iterOpts)
+
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		select {
+		case <-ctx.Done():
+			if err := batch.Commit(); err != nil {
+				return stats, err
+			}
+			return stats, nil
+		default:
+		}
+
+		item := iter.Item()
+		key := item.Key
+
+		stored, err := decodeDbInfo(item.Value)
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+
+		relPath, err := filepath.Rel(s.Root, stored.AbsPath)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+
+		incoming, ok := seen[string(key)]
+		if !ok {
+			stats.Deleted++
+			if cfg.Prune && !cfg.DryRun {
+				if err := batch.Delete(key); err != nil {
+					log.Println(err.Error())
+					continue
+				}
+				stats.Pruned++
+			}
+			continue
+		}
+		delete(seen, string(key))
+
+		switch classifyFile(stored, incoming, cfg.Encoder) {
+		case ReencodeNeeded:
+			incoming.Process = true
+			stats.ToProcess++
+		case FileMoved:
+			incoming.Process = false
+			stats.Moved++
+		default:
+			incoming.Process = false
+			stats.Unchanged++
+		}
+
+		if !cfg.DryRun {
+			if err := incoming.updateFile(batch, key); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	for key, incoming := range seen {
+		incoming.Process = true
+		stats.New++
+		stats.ToProcess++
+
+		if !cfg.DryRun {
+			if err := incoming.updateFile(batch, []byte(key)); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if err := batch.Commit(); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// Index reconciles cfg.Path against the database in two passes: it first
+// walks the tree and hashes every file it finds, then classifies each hash
+// against what's already stored so a rename can be told apart from a
+// delete-and-recreate. See ReconcileStats for the resulting counts.
+func (s *Scanner) Index(ctx context.Context, cfg ScanConfig) (ReconcileStats, error) {
+	spin := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	spin.Start()
+
+	seen, err := s.collectHashes(ctx, cfg, spin)
+	if err != nil {
+		spin.FinalMSG = "Stopping...\n"
+		spin.Stop()
+		return ReconcileStats{}, err
+	}
+
+	stats, err := s.reconcile(ctx, cfg, seen)
+	if err != nil {
+		spin.FinalMSG = "Stopping...\n"
+		spin.Stop()
+		return stats, err
+	}
+
+	if ctx.Err() != nil {
+		spin.FinalMSG = "Stopping...\n"
+	} else {
+		spin.FinalMSG = fmt.Sprintf(
+			"Done indexing: \t%v new, %v moved, %v unchanged, %v orphaned (%v pruned), %v to process\n",
+			stats.New, stats.Moved, stats.Unchanged, stats.Deleted, stats.Pruned, stats.ToProcess,
+		)
+	}
+	spin.Stop()
+
+	return stats, nil
+}
+
+// Reencode resolves every entry the last Index pass marked for processing.
+// Orphan detection and deletion is Index's job; Reencode just skips an
+// entry whose file has disappeared.
+func (s *Scanner) Reencode(ctx context.Context, cfg ScanConfig) error {
+	bar := progressbar.NewOptions64(
+		-1,
+		progressbar.OptionSetDescription("Reencoding..."),
+		progressbar.OptionShowCount(),
+	)
+
+	batch := s.DB.NewBatch(rosedb.DefaultBatchOptions)
+
+	wg := new(errgroup.Group)
+	wg.SetLimit(4)
+
+	iterOpts := rosedb.DefaultIteratorOptions
+	iterOpts.ContinueOnError = true
+	iter := s.DB.NewIterator(iterOpts)
+
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			bar.Exit()
+			return nil
+		default:
+			item := iter.Item()
+			key := item.Key
+			info, err := decodeDbInfo(item.Value)
+			if err != nil {
+				log.Println(err.Error())
+				continue
+			}
+
+			if !info.Process {
+				continue
+			}
+
+			relPath, err := filepath.Rel(s.Root, info.AbsPath)
+			if err != nil || strings.HasPrefix(relPath, "..") {
+				continue
+			}
+
+			if _, err := fs.Stat(s.FS, relPath); err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					log.Println(err.Error())
+				}
+				continue
+			}
+
+			wg.Go(func() error {
+				select {
+				case <-ctx.Done():
+					return nil
+				default:
+					if err := info.reencodeFile(ctx, s.Transcoder, cfg.Encoder, cfg.Args); err != nil {
+						return err
+					}
+					if err := batch.Delete(key); err != nil {
+						return err
+					}
+					newRelPath, err := filepath.Rel(s.Root, info.AbsPath)
+					if err != nil {
+						return err
+					}
+					newKey, err := getSha256(s.FS, newRelPath)
+					if err != nil {
+						return err
+					}
+					if err := info.updateFile(batch, newKey); err != nil {
+						return err
+					}
+
+					bar.Add64(1)
+					return nil
+				}
+			})
+		}
+	}
+
+	wg.Wait()
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	bar.Close()
+	return nil
+}
@@ -0,0 +1,362 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2"
+
+	"github.com/justjakka/reencoder/files/internal/mockfs"
+)
+
+func newTestDB(t *testing.T) *rosedb.DB {
+	t.Helper()
+
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+
+	db, err := rosedb.Open(options)
+	if err != nil {
+		t.Fatalf("rosedb.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func newMockTranscoder(vendor map[string]string) *mockfs.Transcoder {
+	return &mockfs.Transcoder{
+		Codec:     "flac",
+		Extension: ".flac",
+		Vers:      "1.4.3",
+		Vendor:    vendor,
+	}
+}
+
+func newTestScanner(t *testing.T, fsys map[string]string) (*Scanner, *mockfs.Transcoder) {
+	t.Helper()
+
+	specs := make([]mockfs.FileSpec, 0, len(fsys))
+	for path, encoder := range fsys {
+		specs = append(specs, mockfs.FileSpec{Path: path, Encoder: encoder})
+	}
+
+	transcoder := newMockTranscoder(fsys)
+
+	return &Scanner{
+		FS:         mockfs.New(specs...),
+		Root:       "",
+		Transcoder: transcoder,
+		Probe:      transcoder,
+		DB:         newTestDB(t),
+	}, transcoder
+}
+
+func sha256Of(content string) []byte {
+	sum := sha256.Sum256([]byte(content))
+	return sum[:]
+}
+
+// getTestInfo fetches and decodes whatever is stored under hashsum, failing
+// the test if it's missing.
+func getTestInfo(t *testing.T, db *rosedb.DB, hashsum []byte) *FileInfo {
+	t.Helper()
+
+	batch := db.NewBatch(rosedb.DefaultBatchOptions)
+	defer batch.Commit()
+
+	value, err := batch.Get(hashsum)
+	if err != nil {
+		t.Fatalf("batch.Get: %v", err)
+	}
+	info, err := decodeDbInfo(value)
+	if err != nil {
+		t.Fatalf("decodeDbInfo: %v", err)
+	}
+	return info
+}
+
+func keyExists(t *testing.T, db *rosedb.DB, hashsum []byte) bool {
+	t.Helper()
+
+	batch := db.NewBatch(rosedb.DefaultBatchOptions)
+	defer batch.Commit()
+
+	exists, err := batch.Exist(hashsum)
+	if err != nil {
+		t.Fatalf("batch.Exist: %v", err)
+	}
+	return exists
+}
+
+func TestScannerIndex_NewFile(t *testing.T) {
+	scanner, _ := newTestScanner(t, map[string]string{"a.flac": "1.4.3"})
+
+	cfg := ScanConfig{Path: ".", Encoder: EncoderInfo{Codec: "flac", Version: "1.4.3"}}
+	stats, err := scanner.Index(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if stats.New != 1 || stats.ToProcess != 1 {
+		t.Errorf("stats = %+v, want New=1, ToProcess=1", stats)
+	}
+
+	info := getTestInfo(t, scanner.DB, sha256Of("a.flac"))
+	if !info.Process {
+		t.Errorf("new file should be marked for processing")
+	}
+}
+
+func TestScannerIndex_ConcurrentWorkers(t *testing.T) {
+	tree := map[string]string{
+		"a.flac":        "1.4.3",
+		"b.flac":        "1.4.3",
+		"nested/c.flac": "1.3.0",
+	}
+	scanner, _ := newTestScanner(t, tree)
+
+	cfg := ScanConfig{
+		Path:    ".",
+		Encoder: EncoderInfo{Codec: "flac", Version: "1.4.3"},
+		Workers: 4,
+	}
+	stats, err := scanner.Index(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if stats.New != int64(len(tree)) {
+		t.Errorf("stats.New = %v, want %v", stats.New, len(tree))
+	}
+
+	for path := range tree {
+		// Every file is new on this first pass, so all of them are flagged
+		// for processing regardless of their vendor tag.
+		info := getTestInfo(t, scanner.DB, sha256Of(path))
+		if !info.Process {
+			t.Errorf("%s: Process = false, want true", path)
+		}
+	}
+}
+
+func TestClassifyFile(t *testing.T) {
+	target := EncoderInfo{Codec: "flac", Version: "1.4.3"}
+	stale := EncoderInfo{Codec: "flac", Version: "1.3.0"}
+
+	tests := []struct {
+		name       string
+		stored     *FileInfo
+		incoming   *FileInfo
+		wantStatus error
+	}{
+		{
+			name:       "reencode needed: still flagged from last run",
+			stored:     &FileInfo{AbsPath: "a.flac", Encoder: target, Process: true},
+			incoming:   &FileInfo{AbsPath: "a.flac", Encoder: target},
+			wantStatus: ReencodeNeeded,
+		},
+		{
+			name:       "reencode needed: file not yet encoded with target version",
+			stored:     &FileInfo{AbsPath: "a.flac", Encoder: target},
+			incoming:   &FileInfo{AbsPath: "a.flac", Encoder: stale},
+			wantStatus: ReencodeNeeded,
+		},
+		{
+			name:       "file moved: same hash, new path",
+			stored:     &FileInfo{AbsPath: "old/a.flac", Encoder: target},
+			incoming:   &FileInfo{AbsPath: "a.flac", Encoder: target},
+			wantStatus: FileMoved,
+		},
+		{
+			name:       "reencode not needed",
+			stored:     &FileInfo{AbsPath: "a.flac", Encoder: target},
+			incoming:   &FileInfo{AbsPath: "a.flac", Encoder: target},
+			wantStatus: ReencodeNotNeeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := classifyFile(tt.stored, tt.incoming, target); status != tt.wantStatus {
+				t.Errorf("classifyFile() = %v, want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// TestScannerIndex_FileMoved guards against the bug where a renamed file
+// was indistinguishable from an up-to-date one and silently kept its old,
+// now-stale AbsPath.
+func TestScannerIndex_FileMoved(t *testing.T) {
+	db := newTestDB(t)
+	target := EncoderInfo{Codec: "flac", Version: "1.4.3"}
+	const content = "same-bytes"
+
+	scannerAt := func(path string) *Scanner {
+		transcoder := newMockTranscoder(map[string]string{path: "1.4.3"})
+		return &Scanner{
+			FS:         mockfs.New(mockfs.FileSpec{Path: path, Content: content}),
+			Transcoder: transcoder,
+			Probe:      transcoder,
+			DB:         db,
+		}
+	}
+
+	if _, err := scannerAt("old/a.flac").Index(context.Background(), ScanConfig{Path: ".", Encoder: target}); err != nil {
+		t.Fatalf("Index (initial): %v", err)
+	}
+
+	hashsum := sha256Of(content)
+	info := getTestInfo(t, db, hashsum)
+	info.Process = false
+	batch := db.NewBatch(rosedb.DefaultBatchOptions)
+	if err := info.updateFile(batch, hashsum); err != nil {
+		t.Fatalf("updateFile: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	stats, err := scannerAt("a.flac").Index(context.Background(), ScanConfig{Path: ".", Encoder: target})
+	if err != nil {
+		t.Fatalf("Index (moved): %v", err)
+	}
+	if stats.Moved != 1 {
+		t.Errorf("stats.Moved = %v, want 1", stats.Moved)
+	}
+
+	moved := getTestInfo(t, db, hashsum)
+	if moved.AbsPath != "a.flac" {
+		t.Errorf("AbsPath = %q, want %q", moved.AbsPath, "a.flac")
+	}
+	if moved.Process {
+		t.Errorf("a moved file should not be flagged for reencoding")
+	}
+}
+
+// TestScannerIndex_OrphanAndPrune checks that Index counts an entry whose
+// file is gone from the tree as Deleted, keeps it without Prune, and only
+// removes it from the database when Prune is set.
+func TestScannerIndex_OrphanAndPrune(t *testing.T) {
+	db := newTestDB(t)
+	target := EncoderInfo{Codec: "flac", Version: "1.4.3"}
+
+	seedTranscoder := newMockTranscoder(map[string]string{"gone.flac": "1.4.3"})
+	seed := &Scanner{
+		FS:         mockfs.New(mockfs.FileSpec{Path: "gone.flac"}),
+		Transcoder: seedTranscoder,
+		Probe:      seedTranscoder,
+		DB:         db,
+	}
+	if _, err := seed.Index(context.Background(), ScanConfig{Path: ".", Encoder: target}); err != nil {
+		t.Fatalf("Index (seed): %v", err)
+	}
+
+	empty := &Scanner{FS: mockfs.New(), Transcoder: seedTranscoder, Probe: seedTranscoder, DB: db}
+	hashsum := sha256Of("gone.flac")
+
+	stats, err := empty.Index(context.Background(), ScanConfig{Path: ".", Encoder: target})
+	if err != nil {
+		t.Fatalf("Index (no prune): %v", err)
+	}
+	if stats.Deleted != 1 || stats.Pruned != 0 {
+		t.Errorf("stats = %+v, want Deleted=1, Pruned=0", stats)
+	}
+	if !keyExists(t, db, hashsum) {
+		t.Errorf("orphan entry should survive without --prune")
+	}
+
+	stats, err = empty.Index(context.Background(), ScanConfig{Path: ".", Encoder: target, Prune: true})
+	if err != nil {
+		t.Fatalf("Index (prune): %v", err)
+	}
+	if stats.Deleted != 1 || stats.Pruned != 1 {
+		t.Errorf("stats = %+v, want Deleted=1, Pruned=1", stats)
+	}
+	if keyExists(t, db, hashsum) {
+		t.Errorf("orphan entry should be removed with --prune")
+	}
+}
+
+func TestScannerIndex_DryRun(t *testing.T) {
+	scanner, _ := newTestScanner(t, map[string]string{"a.flac": "1.4.3"})
+	target := EncoderInfo{Codec: "flac", Version: "1.4.3"}
+
+	stats, err := scanner.Index(context.Background(), ScanConfig{Path: ".", Encoder: target, DryRun: true})
+	if err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if stats.New != 1 {
+		t.Errorf("stats.New = %v, want 1", stats.New)
+	}
+	if keyExists(t, scanner.DB, sha256Of("a.flac")) {
+		t.Errorf("dry run should not write to the database")
+	}
+}
+
+// TestScannerIndex_SourceExtIndependentOfCodec guards against the bug where
+// the scan walk filtered on the configured --codec's output extension
+// instead of recognized source extensions, which meant indexing a FLAC
+// library with --codec opus never matched any file.
+func TestScannerIndex_SourceExtIndependentOfCodec(t *testing.T) {
+	fsys := mockfs.New(
+		mockfs.FileSpec{Path: "a.flac"},
+		mockfs.FileSpec{Path: "cover.jpg"},
+	)
+	transcoder := &mockfs.Transcoder{Codec: "opus", Extension: ".opus", Vers: "1.0"}
+	scanner := &Scanner{FS: fsys, Transcoder: transcoder, Probe: transcoder, DB: newTestDB(t)}
+
+	cfg := ScanConfig{Path: ".", Encoder: EncoderInfo{Codec: "opus", Version: "1.0"}}
+	stats, err := scanner.Index(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if stats.New != 1 {
+		t.Errorf("stats.New = %v, want 1 (only a.flac should be picked up)", stats.New)
+	}
+}
+
+// TestScannerReencode_CodecChange guards against the bug where reencodeFile
+// never updated FileInfo.AbsPath, so a flac->opus run left the DB pointing
+// at a path that no longer existed. It drives Reencode through the mock
+// Transcoder's extension swap; FFmpegTranscoder's own output path is
+// covered by TestReencodeTargetPath.
+func TestScannerReencode_CodecChange(t *testing.T) {
+	fsys := mockfs.New(mockfs.FileSpec{Path: "a.flac"})
+	transcoder := &mockfs.Transcoder{Codec: "opus", Extension: ".opus", Vers: "1.0", FS: fsys}
+	scanner := &Scanner{FS: fsys, Transcoder: transcoder, Probe: transcoder, DB: newTestDB(t)}
+
+	target := EncoderInfo{Codec: "opus", Version: "1.0"}
+	cfg := ScanConfig{Path: ".", Encoder: target}
+
+	if _, err := scanner.Index(context.Background(), cfg); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+
+	hashsum := sha256Of("a.flac")
+	if err := scanner.Reencode(context.Background(), cfg); err != nil {
+		t.Fatalf("Reencode: %v", err)
+	}
+
+	if len(transcoder.Encoded) != 1 || transcoder.Encoded[0] != "a.flac" {
+		t.Errorf("Encoded = %v, want [a.flac]", transcoder.Encoded)
+	}
+
+	info := getTestInfo(t, scanner.DB, hashsum)
+	if info.AbsPath != "a.opus" {
+		t.Errorf("AbsPath = %q, want %q", info.AbsPath, "a.opus")
+	}
+	if info.Encoder != target {
+		t.Errorf("Encoder = %+v, want %+v", info.Encoder, target)
+	}
+	if info.Process {
+		t.Errorf("reencoded file should no longer be flagged for processing")
+	}
+
+	if _, ok := fsys["a.flac"]; ok {
+		t.Errorf("source file should no longer exist after a codec change")
+	}
+	if _, ok := fsys["a.opus"]; !ok {
+		t.Errorf("reencoded file should exist at the new extension")
+	}
+}
@@ -0,0 +1,201 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type Transcoder interface {
+	Name() string
+	Ext() string
+	Version() (string, error)
+	// Encode transcodes src in place and returns the path the result ended
+	// up at, which differs from src whenever the target codec's extension
+	// isn't src's own (e.g. reencoding a .flac to Opus produces a .opus).
+	Encode(ctx context.Context, src string, args []string) (string, error)
+}
+
+// MetadataProbe reads back the encoder/vendor tag a Transcoder left behind in
+// a file, kept separate from Transcoder so a Scanner can be tested against a
+// fake probe without shelling out to metaflac/ffprobe.
+type MetadataProbe interface {
+	Probe(path string) (string, error)
+}
+
+var ffmpegCodecs = map[string]string{
+	"opus":   "libopus",
+	"mp3":    "libmp3lame",
+	"vorbis": "libvorbis",
+	"alac":   "alac",
+	"aac":    "aac",
+}
+
+var ffmpegExt = map[string]string{
+	"opus":   ".opus",
+	"mp3":    ".mp3",
+	"vorbis": ".ogg",
+	"alac":   ".m4a",
+	"aac":    ".m4a",
+}
+
+// audioExtensions is every extension a source file might carry, independent
+// of which codec a run targets: indexing a library being reencoded to Opus
+// still needs to find its .flac files, and a library reencoded before needs
+// to find the formats earlier runs already produced.
+var audioExtensions = map[string]bool{
+	".flac": true,
+	".opus": true,
+	".mp3":  true,
+	".ogg":  true,
+	".m4a":  true,
+	".aac":  true,
+}
+
+// isAudioFile reports whether path carries a recognized source extension.
+// Unlike Transcoder.Ext(), which names the *output* of the configured
+// codec, this is what the scanner's walk filters on.
+func isAudioFile(path string) bool {
+	return audioExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// reencodeTargetPath returns the path Encode should write its output to:
+// src with its extension swapped for ext, so a flac->opus run produces
+// track.opus instead of leaving Opus-encoded bytes in a file still named
+// track.flac.
+func reencodeTargetPath(src, ext string) string {
+	return strings.TrimSuffix(src, filepath.Ext(src)) + ext
+}
+
+func NewTranscoder(codec string) (Transcoder, error) {
+	if codec == "flac" {
+		return FlacTranscoder{}, nil
+	}
+	if _, ok := ffmpegCodecs[codec]; ok {
+		return FFmpegTranscoder{Codec: codec}, nil
+	}
+	return nil, fmt.Errorf("unsupported codec %q", codec)
+}
+
+func DefaultArgs(codec string) []string {
+	switch codec {
+	case "flac":
+		return []string{"-8f", "-j4"}
+	case "opus":
+		return []string{"-b:a", "192k"}
+	case "mp3":
+		return []string{"-b:a", "320k"}
+	case "vorbis":
+		return []string{"-q:a", "8"}
+	case "aac":
+		return []string{"-b:a", "256k"}
+	default:
+		return nil
+	}
+}
+
+type FlacTranscoder struct{}
+
+func (FlacTranscoder) Name() string { return "flac" }
+
+func (FlacTranscoder) Ext() string { return ".flac" }
+
+func (FlacTranscoder) Version() (string, error) {
+	out, err := exec.Command("flac", "-v").Output()
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Split(string(out), " ")
+	if len(fields) < 2 {
+		return "", fmt.Errorf("unexpected flac -v output: %q", out)
+	}
+	return strings.TrimSpace(fields[1]), nil
+}
+
+func (FlacTranscoder) Probe(path string) (string, error) {
+	out, err := exec.Command("metaflac", "--show-vendor-tag", path).Output()
+	if err != nil {
+		return "", err
+	}
+
+	r := regexp.MustCompile(`libFLAC \d\.\d\.\d`)
+	encoder := r.FindString(string(out))
+	if encoder == "" {
+		return "", nil
+	}
+	return strings.Split(encoder, " ")[1], nil
+}
+
+func (FlacTranscoder) Encode(ctx context.Context, src string, args []string) (string, error) {
+	full := append(append([]string{}, args...), src)
+	cmd := exec.CommandContext(ctx, "flac", full...)
+	if err := cmd.Run(); err != nil && !strings.Contains(err.Error(), "interrupt") {
+		return "", err
+	}
+	return src, nil
+}
+
+type FFmpegTranscoder struct {
+	Codec string
+}
+
+func (f FFmpegTranscoder) Name() string { return f.Codec }
+
+func (f FFmpegTranscoder) Ext() string { return ffmpegExt[f.Codec] }
+
+func (f FFmpegTranscoder) Version() (string, error) {
+	out, err := exec.Command("ffmpeg", "-version").Output()
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("unexpected ffmpeg -version output: %q", out)
+	}
+	return fields[2], nil
+}
+
+func (f FFmpegTranscoder) Probe(path string) (string, error) {
+	out, err := exec.Command(
+		"ffprobe", "-v", "error",
+		"-show_entries", "format_tags=encoder",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (f FFmpegTranscoder) Encode(ctx context.Context, src string, args []string) (string, error) {
+	encoder, ok := ffmpegCodecs[f.Codec]
+	if !ok {
+		return "", fmt.Errorf("unsupported ffmpeg codec %q", f.Codec)
+	}
+
+	dst := reencodeTargetPath(src, f.Ext())
+	// ffmpeg picks its output muxer from the file extension, so the
+	// temporary file keeps the target extension.
+	tmp := reencodeTargetPath(src, ".reencode"+f.Ext())
+	full := append([]string{"-y", "-i", src, "-c:a", encoder}, args...)
+	full = append(full, tmp)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", full...)
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return "", err
+	}
+	if dst != src {
+		if err := os.Remove(src); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,47 @@
+package files
+
+import "testing"
+
+func TestIsAudioFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"track.flac", true},
+		{"track.opus", true},
+		{"track.mp3", true},
+		{"track.ogg", true},
+		{"track.m4a", true},
+		{"track.aac", true},
+		{"track.FLAC", true},
+		{"cover.jpg", false},
+		{"track.txt", false},
+	}
+
+	for _, tt := range tests {
+		if got := isAudioFile(tt.path); got != tt.want {
+			t.Errorf("isAudioFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestReencodeTargetPath guards against the bug where reencoding to a
+// different codec left the output sitting in a file still named after the
+// source extension (e.g. Opus-encoded bytes in a file named track.flac).
+func TestReencodeTargetPath(t *testing.T) {
+	tests := []struct {
+		src  string
+		ext  string
+		want string
+	}{
+		{"music/track.flac", ".opus", "music/track.opus"},
+		{"music/track.flac", ".flac", "music/track.flac"},
+		{"music/nested/track.FLAC", ".mp3", "music/nested/track.mp3"},
+	}
+
+	for _, tt := range tests {
+		if got := reencodeTargetPath(tt.src, tt.ext); got != tt.want {
+			t.Errorf("reencodeTargetPath(%q, %q) = %q, want %q", tt.src, tt.ext, got, tt.want)
+		}
+	}
+}
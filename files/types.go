@@ -10,8 +10,13 @@ var (
 	ReencodeNeeded    = errors.New("file needs to be reencoded")
 )
 
+type EncoderInfo struct {
+	Codec   string `json:"codec"`
+	Version string `json:"version"`
+}
+
 type FileInfo struct {
-	AbsPath string `json:"abspath"`
-	Encoder string `json:"encoder"`
-	Process bool   `json:"process"`
+	AbsPath string      `json:"abspath"`
+	Encoder EncoderInfo `json:"encoder"`
+	Process bool        `json:"process"`
 }